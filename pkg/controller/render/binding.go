@@ -0,0 +1,137 @@
+package render
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	mcfgv1 "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+// nodeBindingPoolLabel and nodeBindingNodeLabel are stamped on every RenderedMachineConfigBinding
+// this controller creates, so the pool and node a binding is for can be recovered without
+// decoding its name.
+const (
+	nodeBindingPoolLabel = "machineconfiguration.openshift.io/pool"
+	nodeBindingNodeLabel = "machineconfiguration.openshift.io/node"
+)
+
+// bindingName returns the deterministic RenderedMachineConfigBinding name for a (pool, node)
+// pair, so syncNodeBinding can look one up without an index.
+func bindingName(poolName, nodeName string) string {
+	return fmt.Sprintf("%s-%s", poolName, nodeName)
+}
+
+// syncNodeBindings creates or updates one RenderedMachineConfigBinding per node matched by
+// pool.Spec.NodeSelector, pointing spec.targetConfig at targetConfig. status.currentConfig is
+// left untouched for the machine-config-daemon running on each node to fill in once it has
+// actually applied the config. A node with no binding yet (e.g. because this feature was
+// just enabled) is not an error -- its binding is created here. pool.Status.Configuration
+// is maintained independently of the bindings.
+func (ctrl *Controller) syncNodeBindings(pool *mcfgv1.MachineConfigPool, targetConfig string) error {
+	if ctrl.rmcbLister == nil {
+		return nil
+	}
+
+	nodeSelector, err := metav1.LabelSelectorAsSelector(pool.Spec.NodeSelector)
+	if err != nil {
+		return fmt.Errorf("invalid node selector: %v", err)
+	}
+
+	nodes, err := ctrl.nodeLister.List(nodeSelector)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range nodes {
+		if err := ctrl.syncNodeBinding(pool, node.Name, targetConfig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncNodeBinding creates, or updates the targetConfig of, the RenderedMachineConfigBinding
+// for a single node.
+func (ctrl *Controller) syncNodeBinding(pool *mcfgv1.MachineConfigPool, nodeName, targetConfig string) error {
+	name := bindingName(pool.Name, nodeName)
+
+	existing, err := ctrl.rmcbLister.Get(name)
+	if errors.IsNotFound(err) {
+		binding := &mcfgv1.RenderedMachineConfigBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				Labels: map[string]string{
+					nodeBindingPoolLabel: pool.Name,
+					nodeBindingNodeLabel: nodeName,
+				},
+				OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(pool, controllerKind)},
+			},
+			Spec: mcfgv1.RenderedMachineConfigBindingSpec{
+				Node:         nodeName,
+				TargetConfig: targetConfig,
+			},
+		}
+		_, err := ctrl.client.MachineconfigurationV1().RenderedMachineConfigBindings().Create(binding)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if existing.Spec.TargetConfig == targetConfig {
+		return nil
+	}
+
+	updated := existing.DeepCopy()
+	updated.Spec.TargetConfig = targetConfig
+	_, err = ctrl.client.MachineconfigurationV1().RenderedMachineConfigBindings().Update(updated)
+	return err
+}
+
+func (ctrl *Controller) addRenderedMachineConfigBinding(obj interface{}) {
+	binding := obj.(*mcfgv1.RenderedMachineConfigBinding)
+	glog.V(4).Infof("RenderedMachineConfigBinding %s added", binding.Name)
+	ctrl.enqueueBindingOwner(binding)
+}
+
+func (ctrl *Controller) updateRenderedMachineConfigBinding(old, cur interface{}) {
+	curBinding := cur.(*mcfgv1.RenderedMachineConfigBinding)
+	glog.V(4).Infof("RenderedMachineConfigBinding %s updated", curBinding.Name)
+	ctrl.enqueueBindingOwner(curBinding)
+}
+
+func (ctrl *Controller) deleteRenderedMachineConfigBinding(obj interface{}) {
+	binding, ok := obj.(*mcfgv1.RenderedMachineConfigBinding)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("Couldn't get object from tombstone %#v", obj))
+			return
+		}
+		binding, ok = tombstone.Obj.(*mcfgv1.RenderedMachineConfigBinding)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("Tombstone contained object that is not a RenderedMachineConfigBinding %#v", obj))
+			return
+		}
+	}
+	glog.V(4).Infof("RenderedMachineConfigBinding %s deleted", binding.Name)
+	ctrl.enqueueBindingOwner(binding)
+}
+
+// enqueueBindingOwner enqueues the MachineConfigPool that owns binding, so a change to a
+// binding's status (e.g. the node agent reporting a new status.currentConfig) is reflected
+// in the owning pool's progress without waiting for a pool or MachineConfig resync.
+func (ctrl *Controller) enqueueBindingOwner(binding *mcfgv1.RenderedMachineConfigBinding) {
+	controllerRef := metav1.GetControllerOf(binding)
+	if controllerRef == nil {
+		return
+	}
+	pool := ctrl.resolveControllerRef(controllerRef)
+	if pool == nil {
+		return
+	}
+	ctrl.enqueueMachineConfigPool(pool)
+}
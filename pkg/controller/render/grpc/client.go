@@ -0,0 +1,59 @@
+package grpc
+
+import (
+	"context"
+
+	pb "github.com/openshift/machine-config-operator/pkg/controller/render/grpc/renderedconfigpb"
+	"google.golang.org/grpc"
+)
+
+// Client is a thin wrapper over the generated RenderedConfigServiceClient that hands callers
+// a plain Go channel instead of requiring them to drive the stream's Recv loop themselves.
+type Client struct {
+	conn *grpc.ClientConn
+	pb   pb.RenderedConfigServiceClient
+}
+
+// Dial connects to a render controller's gRPC push server at target.
+func Dial(target string, opts ...grpc.DialOption) (*Client, error) {
+	conn, err := grpc.Dial(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, pb: pb.NewRenderedConfigServiceClient(conn)}, nil
+}
+
+// Close tears down the underlying connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Watch subscribes to promotions for pool, resuming from lastKnownHash (pass "" to always
+// receive the pool's current state first). The returned channel is closed when ctx is done
+// or the stream ends; heartbeats are filtered out before reaching the caller.
+func (c *Client) Watch(ctx context.Context, pool, lastKnownHash string) (<-chan *pb.RenderedConfig, error) {
+	stream, err := c.pb.WatchRenderedConfig(ctx, &pb.WatchRenderedConfigRequest{Pool: pool, LastKnownHash: lastKnownHash})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan *pb.RenderedConfig)
+	go func() {
+		defer close(out)
+		for {
+			cfg, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			if cfg.Heartbeat {
+				continue
+			}
+			select {
+			case out <- cfg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,189 @@
+// Package grpc hosts an optional push server for the render controller: instead of (or in
+// addition to) polling the API server, a subscriber can hold open a WatchRenderedConfig
+// stream per pool and get the newly-promoted MachineConfig within milliseconds of a
+// promotion. The wire contract lives in renderedconfig.proto; RegisterRenderedConfigServiceServer
+// and the message types in renderedconfigpb come from running protoc over it (see
+// hack/update-render-grpc-codegen.sh), the same way pkg/generated is produced from the
+// MachineConfig API types.
+//
+//go:generate ../../../../hack/update-render-grpc-codegen.sh
+package grpc
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	pb "github.com/openshift/machine-config-operator/pkg/controller/render/grpc/renderedconfigpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	// subscriberBufferSize bounds the fan-out channel for each subscriber. A push to a
+	// subscriber that has fallen this far behind is dropped for that subscriber rather than
+	// allowed to stall Push; the subscriber itself stays subscribed.
+	subscriberBufferSize = 16
+
+	// heartbeatInterval is how often an idle stream gets a keep-alive push.
+	heartbeatInterval = 30 * time.Second
+)
+
+// Server hosts the RenderedConfigService gRPC API. The render controller calls Push whenever
+// it promotes a new MachineConfig for a pool; Server fans that out to every subscriber
+// currently watching that pool over a non-blocking channel, so one slow subscriber can never
+// stall the controller's own sync loop.
+type Server struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan *pb.RenderedConfig]struct{}
+	lastPushed  map[string]*pb.RenderedConfig
+	// closed is set under mu by Stop, so a Push racing with shutdown sees it and skips
+	// fanning out entirely instead of potentially sending to a subscriber whose stream is
+	// already tearing down.
+	closed bool
+	// done is closed by Stop before GracefulStop is called, so every open WatchRenderedConfig
+	// stream notices and returns immediately instead of GracefulStop blocking on it.
+	done chan struct{}
+
+	grpcServer *grpc.Server
+}
+
+// NewServer constructs a Server. Pass both certFile and keyFile to serve over TLS using the
+// operator's existing serving certificate; leave both empty to serve insecurely, e.g. in tests.
+func NewServer(certFile, keyFile string) (*Server, error) {
+	s := &Server{
+		subscribers: map[string]map[chan *pb.RenderedConfig]struct{}{},
+		lastPushed:  map[string]*pb.RenderedConfig{},
+		done:        make(chan struct{}),
+	}
+
+	var opts []grpc.ServerOption
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load serving cert for render grpc server: %v", err)
+		}
+		opts = append(opts, grpc.Creds(credentials.NewServerTLSFromCert(&cert)))
+	}
+
+	s.grpcServer = grpc.NewServer(opts...)
+	pb.RegisterRenderedConfigServiceServer(s.grpcServer, s)
+	return s, nil
+}
+
+// Serve blocks accepting connections on lis until Stop is called.
+func (s *Server) Serve(lis net.Listener) error {
+	return s.grpcServer.Serve(lis)
+}
+
+// Stop gracefully shuts the server down. It is safe to call concurrently with Push.
+func (s *Server) Stop() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	// Signal every open WatchRenderedConfig stream to return before calling GracefulStop,
+	// which otherwise blocks until all active RPCs finish -- and a long-lived watch stream
+	// would never finish on its own. Streams exit via this signal rather than via their
+	// subscriber channel being closed, which is deliberate: closing a subscriber channel here
+	// while Push might concurrently be sending on it (Push sends after releasing s.mu, so it
+	// can't be serialized against this close under the same lock) would risk a send-on-closed
+	// panic. s.closed, set above, stops Push from registering any further subscribers' work
+	// after this point; existing subscriber channels are simply abandoned for GC once their
+	// stream goroutine returns.
+	close(s.done)
+	s.grpcServer.GracefulStop()
+}
+
+// Push fans cfg out to every current subscriber of cfg.Pool and records it as the pool's
+// current state for subscribers that connect later. Sends are non-blocking: a subscriber
+// whose buffer is already full misses this push rather than being allowed to stall the caller, which is
+// the render controller's own sync loop. Push is a no-op once Stop has been called.
+func (s *Server) Push(cfg *pb.RenderedConfig) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.lastPushed[cfg.Pool] = cfg
+	subs := s.subscribers[cfg.Pool]
+	chans := make([]chan *pb.RenderedConfig, 0, len(subs))
+	for ch := range subs {
+		chans = append(chans, ch)
+	}
+	s.mu.Unlock()
+
+	for _, ch := range chans {
+		select {
+		case ch <- cfg:
+		default:
+			glog.Warningf("render grpc: subscriber for pool %s is falling behind, dropping push of %s", cfg.Pool, cfg.ConfigName)
+		}
+	}
+}
+
+// WatchRenderedConfig implements pb.RenderedConfigServiceServer.
+func (s *Server) WatchRenderedConfig(req *pb.WatchRenderedConfigRequest, stream pb.RenderedConfigService_WatchRenderedConfigServer) error {
+	ch := make(chan *pb.RenderedConfig, subscriberBufferSize)
+	s.subscribe(req.Pool, ch)
+	defer s.unsubscribe(req.Pool, ch)
+
+	lastSentHash := req.LastKnownHash
+	if current := s.currentFor(req.Pool); current != nil && current.ContentHash != lastSentHash {
+		if err := stream.Send(current); err != nil {
+			return err
+		}
+		lastSentHash = current.ContentHash
+	}
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case cfg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if cfg.ContentHash == lastSentHash {
+				continue
+			}
+			if err := stream.Send(cfg); err != nil {
+				return err
+			}
+			lastSentHash = cfg.ContentHash
+		case <-s.done:
+			return nil
+		case <-ticker.C:
+			if err := stream.Send(&pb.RenderedConfig{Pool: req.Pool, Heartbeat: true}); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+func (s *Server) subscribe(pool string, ch chan *pb.RenderedConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subscribers[pool] == nil {
+		s.subscribers[pool] = map[chan *pb.RenderedConfig]struct{}{}
+	}
+	s.subscribers[pool][ch] = struct{}{}
+}
+
+func (s *Server) unsubscribe(pool string, ch chan *pb.RenderedConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscribers[pool], ch)
+}
+
+func (s *Server) currentFor(pool string) *pb.RenderedConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastPushed[pool]
+}
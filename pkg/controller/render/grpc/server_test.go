@@ -0,0 +1,136 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/openshift/machine-config-operator/pkg/controller/render/grpc/renderedconfigpb"
+	"google.golang.org/grpc"
+)
+
+// TestWatchRenderedConfigDedupesRepeatedContentHash is an integration test: it starts a real
+// Server on a loopback listener, dials a real Client against it over the network, and verifies
+// a subscriber gets exactly one event per distinct content hash even when the controller
+// pushes the same hash more than once -- e.g. because a controller-version bump changed a
+// MachineConfig's name without changing its rendered content (see chunk0-3).
+func TestWatchRenderedConfigDedupesRepeatedContentHash(t *testing.T) {
+	srv, err := NewServer("", "")
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	client, err := Dial(lis.Addr().String(), grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	events, err := client.Watch(ctx, "worker", "")
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+
+	// The stream is established asynchronously on the server side, so a Push sent too early
+	// can land before the subscriber is registered and be lost. Retry a throwaway push until
+	// one round-trips, which guarantees every push from here on has a registered subscriber.
+	subscribed := false
+	for i := 0; i < 100 && !subscribed; i++ {
+		srv.Push(&pb.RenderedConfig{Pool: "worker", ConfigName: "warmup", ContentHash: "warmup"})
+		select {
+		case cfg := <-events:
+			if cfg.ContentHash == "warmup" {
+				subscribed = true
+			}
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	if !subscribed {
+		t.Fatalf("subscriber never confirmed registration")
+	}
+
+	srv.Push(&pb.RenderedConfig{Pool: "worker", ConfigName: "rendered-worker-aaa", ContentHash: "hash-1"})
+	srv.Push(&pb.RenderedConfig{Pool: "worker", ConfigName: "rendered-worker-bbb", ContentHash: "hash-1"})
+	srv.Push(&pb.RenderedConfig{Pool: "worker", ConfigName: "rendered-worker-ccc", ContentHash: "hash-2"})
+
+	var got []*pb.RenderedConfig
+	for i := 0; i < 2; i++ {
+		select {
+		case cfg := <-events:
+			got = append(got, cfg)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for event %d, got %d so far: %v", i, len(got), got)
+		}
+	}
+
+	select {
+	case extra := <-events:
+		t.Fatalf("got an unexpected extra event for an unchanged content hash: %+v", extra)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if got[0].ContentHash != "hash-1" || got[0].ConfigName != "rendered-worker-aaa" {
+		t.Errorf("expected the first distinct push (hash-1/rendered-worker-aaa) to be delivered, got %+v", got[0])
+	}
+	if got[1].ContentHash != "hash-2" {
+		t.Errorf("expected the second event to carry the new content hash, got %+v", got[1])
+	}
+}
+
+// TestWatchRenderedConfigResumesFromLastKnownHash proves a reconnecting client that already
+// applied the pool's current config doesn't get it replayed.
+func TestWatchRenderedConfigResumesFromLastKnownHash(t *testing.T) {
+	srv, err := NewServer("", "")
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	srv.Push(&pb.RenderedConfig{Pool: "worker", ConfigName: "rendered-worker-aaa", ContentHash: "hash-1"})
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	client, err := Dial(lis.Addr().String(), grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	events, err := client.Watch(ctx, "worker", "hash-1")
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+
+	// Retry the push until it's received: the subscriber is registered asynchronously on the
+	// server side, so a push sent too early can land before that and be lost. Re-pushing the
+	// same content hash is safe here since WatchRenderedConfig dedupes repeats anyway.
+	for i := 0; i < 100; i++ {
+		srv.Push(&pb.RenderedConfig{Pool: "worker", ConfigName: "rendered-worker-bbb", ContentHash: "hash-2"})
+		select {
+		case cfg := <-events:
+			if cfg.ContentHash != "hash-2" {
+				t.Fatalf("expected the already-known hash-1 to be skipped and hash-2 delivered, got %+v", cfg)
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	t.Fatalf("timed out waiting for the hash-2 push")
+}
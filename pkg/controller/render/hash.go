@@ -0,0 +1,72 @@
+package render
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	mcfgv1 "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
+)
+
+// renderedContentHashAnnotationKey names the annotation stamped on a generated MachineConfig,
+// and mirrored onto MachineConfigPoolStatusConfiguration, holding the digest from
+// HashRenderedContent. Unlike the hashed name from getMachineConfigHashedName -- which mixes
+// in pool identity and the controller version -- this hash covers only the rendered payload,
+// so two pools that render byte-identical configs get the same hash even though they get
+// different names.
+const renderedContentHashAnnotationKey = "machineconfiguration.openshift.io/rendered-content-hash"
+
+// renderedContent is the canonical, hashable projection of a MachineConfig: only the fields
+// that actually affect what lands on a node. Name, owner references, and controller-version
+// annotations are deliberately excluded so they can't perturb the hash.
+type renderedContent struct {
+	Config          interface{} `json:"ignitionConfig"`
+	KernelArguments []string    `json:"kernelArguments"`
+	OSImageURL      string      `json:"osImageURL"`
+}
+
+// HashRenderedContent returns a stable SHA-256 hex digest of mc's Ignition config, kernel
+// arguments, and OS image URL. encoding/json sorts map keys during marshaling, so two configs
+// built from the same content hash identically regardless of field ordering -- but only once
+// Config has been canonicalized, since some concrete types (e.g. runtime.RawExtension) marshal
+// through their stored raw bytes verbatim instead of normalizing key order themselves.
+func HashRenderedContent(mc *mcfgv1.MachineConfig) (string, error) {
+	canonicalConfig, err := canonicalizeConfig(mc.Spec.Config)
+	if err != nil {
+		return "", fmt.Errorf("failed to canonicalize ignition config for hashing: %v", err)
+	}
+
+	content := renderedContent{
+		Config:          canonicalConfig,
+		KernelArguments: mc.Spec.KernelArguments,
+		OSImageURL:      mc.Spec.OSImageURL,
+	}
+
+	raw, err := json.Marshal(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal rendered content for hashing: %v", err)
+	}
+
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// canonicalizeConfig round-trips config through a generic interface{} before it's hashed.
+// config's concrete type may marshal through previously-stored raw bytes (runtime.RawExtension
+// does this) rather than normalizing map key order on every call, so two
+// byte-different-but-semantically-identical Ignition payloads would otherwise hash
+// differently. Unmarshaling into interface{} and re-marshaling forces encoding/json's own
+// key-sorting regardless of what the original type did.
+func canonicalizeConfig(config interface{}) (interface{}, error) {
+	raw, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var canonical interface{}
+	if err := json.Unmarshal(raw, &canonical); err != nil {
+		return nil, err
+	}
+	return canonical, nil
+}
@@ -0,0 +1,111 @@
+package render
+
+import (
+	"testing"
+
+	mcfgv1 "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// TestHashRenderedContentIsStable proves HashRenderedContent is deterministic: two
+// MachineConfig values with identical rendered content but constructed independently must
+// hash identically, and repeated calls on the same value must return the same digest.
+func TestHashRenderedContentIsStable(t *testing.T) {
+	a := &mcfgv1.MachineConfig{}
+	a.Spec.KernelArguments = []string{"nosmt", "console=tty0"}
+	a.Spec.OSImageURL = "registry.example.com/os@sha256:aaa"
+
+	b := &mcfgv1.MachineConfig{}
+	b.Spec.KernelArguments = []string{"nosmt", "console=tty0"}
+	b.Spec.OSImageURL = "registry.example.com/os@sha256:aaa"
+
+	hashA, err := HashRenderedContent(a)
+	if err != nil {
+		t.Fatalf("HashRenderedContent(a): %v", err)
+	}
+	hashB, err := HashRenderedContent(b)
+	if err != nil {
+		t.Fatalf("HashRenderedContent(b): %v", err)
+	}
+	if hashA != hashB {
+		t.Fatalf("expected two independently-built MachineConfigs with identical rendered content to hash the same, got %s and %s", hashA, hashB)
+	}
+
+	// Calling it again on the same input must keep returning the same digest.
+	hashA2, err := HashRenderedContent(a)
+	if err != nil {
+		t.Fatalf("HashRenderedContent(a) second call: %v", err)
+	}
+	if hashA != hashA2 {
+		t.Fatalf("expected repeated calls on the same input to be stable, got %s then %s", hashA, hashA2)
+	}
+}
+
+// TestHashRenderedContentExcludesMetadata proves the hash covers only the rendered payload:
+// Name and Annotations (including the controller-version and the hash annotation itself)
+// must not perturb it.
+func TestHashRenderedContentExcludesMetadata(t *testing.T) {
+	base := &mcfgv1.MachineConfig{}
+	base.Spec.KernelArguments = []string{"nosmt"}
+	base.Spec.OSImageURL = "registry.example.com/os@sha256:aaa"
+	baseHash, err := HashRenderedContent(base)
+	if err != nil {
+		t.Fatalf("HashRenderedContent(base): %v", err)
+	}
+
+	withMetadata := &mcfgv1.MachineConfig{}
+	withMetadata.Spec.KernelArguments = []string{"nosmt"}
+	withMetadata.Spec.OSImageURL = "registry.example.com/os@sha256:aaa"
+	withMetadata.SetName("rendered-worker-abc123")
+	withMetadata.Annotations = map[string]string{}
+	withMetadata.Annotations["machineconfiguration.openshift.io/generated-by-controller-version"] = "v1.2.3"
+	withMetadata.Annotations[renderedContentHashAnnotationKey] = "stale-value-from-a-previous-render"
+
+	withMetadataHash, err := HashRenderedContent(withMetadata)
+	if err != nil {
+		t.Fatalf("HashRenderedContent(withMetadata): %v", err)
+	}
+	if withMetadataHash != baseHash {
+		t.Fatalf("expected Name/Annotations to be excluded from the hash, got %s (with metadata) vs %s (without)", withMetadataHash, baseHash)
+	}
+
+	// Sanity: an actual content change must still produce a different hash.
+	changed := &mcfgv1.MachineConfig{}
+	changed.Spec.KernelArguments = []string{"nosmt"}
+	changed.Spec.OSImageURL = "registry.example.com/os@sha256:bbb"
+	changedHash, err := HashRenderedContent(changed)
+	if err != nil {
+		t.Fatalf("HashRenderedContent(changed): %v", err)
+	}
+	if changedHash == baseHash {
+		t.Fatalf("expected a different OSImageURL to change the hash, both got %s", baseHash)
+	}
+}
+
+// TestHashRenderedContentCanonicalizesRawConfig proves the hash is stable across two
+// semantically-identical Ignition configs whose raw bytes differ only in map key order.
+// Spec.Config is a runtime.RawExtension, so its MarshalJSON returns the stored bytes
+// verbatim instead of normalizing key order itself -- without canonicalizing first, these
+// two MachineConfigs would hash differently even though nothing meaningful changed, breaking
+// every steady-state check (handleRendered, chunk0-5's push dedup) that relies on the hash.
+func TestHashRenderedContentCanonicalizesRawConfig(t *testing.T) {
+	a := &mcfgv1.MachineConfig{}
+	a.Spec.OSImageURL = "registry.example.com/os@sha256:aaa"
+	a.Spec.Config = runtime.RawExtension{Raw: []byte(`{"ignition":{"version":"3.2.0"},"storage":{"files":[]}}`)}
+
+	b := &mcfgv1.MachineConfig{}
+	b.Spec.OSImageURL = "registry.example.com/os@sha256:aaa"
+	b.Spec.Config = runtime.RawExtension{Raw: []byte(`{"storage":{"files":[]},"ignition":{"version":"3.2.0"}}`)}
+
+	hashA, err := HashRenderedContent(a)
+	if err != nil {
+		t.Fatalf("HashRenderedContent(a): %v", err)
+	}
+	hashB, err := HashRenderedContent(b)
+	if err != nil {
+		t.Fatalf("HashRenderedContent(b): %v", err)
+	}
+	if hashA != hashB {
+		t.Fatalf("expected two Ignition configs that differ only in key order to hash the same, got %s and %s", hashA, hashB)
+	}
+}
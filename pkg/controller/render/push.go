@@ -0,0 +1,40 @@
+package render
+
+import (
+	"encoding/json"
+
+	"github.com/golang/glog"
+	mcfgv1 "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
+	renderedgrpc "github.com/openshift/machine-config-operator/pkg/controller/render/grpc"
+	pb "github.com/openshift/machine-config-operator/pkg/controller/render/grpc/renderedconfigpb"
+)
+
+// SetPushServer wires an optional gRPC push server into the controller so every promoted
+// MachineConfig is also pushed to subscribers, in addition to being written to the API
+// server. Safe to leave unset: pushRenderedConfig is a no-op without one.
+func (ctrl *Controller) SetPushServer(s *renderedgrpc.Server) {
+	ctrl.pushServer = s
+}
+
+// pushRenderedConfig fans a freshly-promoted MachineConfig out to gRPC subscribers of pool,
+// deduplicated downstream via contentHash (see renderedContentHashAnnotationKey). It never
+// blocks or fails the sync: a marshaling error is logged and swallowed rather than turning an
+// already-successful promotion into a Failed phase.
+func (ctrl *Controller) pushRenderedConfig(poolName string, mc *mcfgv1.MachineConfig, contentHash string) {
+	if ctrl.pushServer == nil {
+		return
+	}
+
+	ignition, err := json.Marshal(mc.Spec.Config)
+	if err != nil {
+		glog.Errorf("render grpc: failed to marshal ignition config for %s, not pushing: %v", mc.Name, err)
+		return
+	}
+
+	ctrl.pushServer.Push(&pb.RenderedConfig{
+		Pool:           poolName,
+		ConfigName:     mc.Name,
+		ContentHash:    contentHash,
+		IgnitionConfig: ignition,
+	})
+}
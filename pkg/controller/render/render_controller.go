@@ -6,9 +6,9 @@ import (
 	"time"
 
 	"github.com/golang/glog"
-	"github.com/openshift/machine-config-operator/lib/resourceapply"
 	mcfgv1 "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
 	"github.com/openshift/machine-config-operator/pkg/controller/common"
+	renderedgrpc "github.com/openshift/machine-config-operator/pkg/controller/render/grpc"
 	mcfgclientset "github.com/openshift/machine-config-operator/pkg/generated/clientset/versioned"
 	"github.com/openshift/machine-config-operator/pkg/generated/clientset/versioned/scheme"
 	mcfginformersv1 "github.com/openshift/machine-config-operator/pkg/generated/informers/externalversions/machineconfiguration.openshift.io/v1"
@@ -16,14 +16,14 @@ import (
 	"github.com/openshift/machine-config-operator/pkg/version"
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
-	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	coreinformersv1 "k8s.io/client-go/informers/core/v1"
 	clientset "k8s.io/client-go/kubernetes"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelistersv1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
@@ -48,6 +48,7 @@ var (
 // Controller defines the render controller.
 type Controller struct {
 	client        mcfgclientset.Interface
+	kubeClient    clientset.Interface
 	eventRecorder record.EventRecorder
 
 	syncHandler              func(mcp string) error
@@ -55,17 +56,42 @@ type Controller struct {
 
 	mcpLister mcfglistersv1.MachineConfigPoolLister
 	mcLister  mcfglistersv1.MachineConfigLister
-
-	mcpListerSynced cache.InformerSynced
-	mcListerSynced  cache.InformerSynced
+	// rmcbLister is nil when the controller was constructed without a
+	// RenderedMachineConfigBindingInformer, which disables per-node binding tracking
+	// entirely and leaves every pool on pool-level Status.Configuration only.
+	rmcbLister mcfglistersv1.RenderedMachineConfigBindingLister
+
+	// nodeLister backs syncNodeBindings, so walking every node in a pool during
+	// handleRendering -- which runs on every canary-deferred requeue, not just on an actual
+	// change -- reads from the informer cache instead of issuing a live LIST against the API
+	// server each time.
+	nodeLister corelistersv1.NodeLister
+
+	mcpListerSynced  cache.InformerSynced
+	mcListerSynced   cache.InformerSynced
+	rmcbListerSynced cache.InformerSynced
+	nodeListerSynced cache.InformerSynced
 
 	queue workqueue.RateLimitingInterface
+
+	// stateFactory vends the render-phase handlers that drive syncMachineConfigPool.
+	stateFactory *Factory
+
+	// pushServer, if set via SetPushServer, receives every promoted MachineConfig so it can
+	// fan the promotion out to gRPC subscribers.
+	pushServer *renderedgrpc.Server
 }
 
 // New returns a new render controller.
+//
+// rmcbInformer may be nil, in which case per-node RenderedMachineConfigBinding tracking is
+// disabled and every pool is driven entirely by pool-level Status.Configuration, as before
+// this type existed.
 func New(
 	mcpInformer mcfginformersv1.MachineConfigPoolInformer,
 	mcInformer mcfginformersv1.MachineConfigInformer,
+	rmcbInformer mcfginformersv1.RenderedMachineConfigBindingInformer,
+	nodeInformer coreinformersv1.NodeInformer,
 	kubeClient clientset.Interface,
 	mcfgClient mcfgclientset.Interface,
 ) *Controller {
@@ -75,8 +101,10 @@ func New(
 
 	ctrl := &Controller{
 		client:        mcfgClient,
+		kubeClient:    kubeClient,
 		eventRecorder: eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "machineconfigcontroller-rendercontroller"}),
 		queue:         workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "machineconfigcontroller-rendercontroller"),
+		stateFactory:  NewStateFactory(),
 	}
 
 	mcpInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -89,6 +117,15 @@ func New(
 		UpdateFunc: ctrl.updateMachineConfig,
 		DeleteFunc: ctrl.deleteMachineConfig,
 	})
+	if rmcbInformer != nil {
+		rmcbInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    ctrl.addRenderedMachineConfigBinding,
+			UpdateFunc: ctrl.updateRenderedMachineConfigBinding,
+			DeleteFunc: ctrl.deleteRenderedMachineConfigBinding,
+		})
+		ctrl.rmcbLister = rmcbInformer.Lister()
+		ctrl.rmcbListerSynced = rmcbInformer.Informer().HasSynced
+	}
 
 	ctrl.syncHandler = ctrl.syncMachineConfigPool
 	ctrl.enqueueMachineConfigPool = ctrl.enqueue
@@ -98,6 +135,9 @@ func New(
 	ctrl.mcpListerSynced = mcpInformer.Informer().HasSynced
 	ctrl.mcListerSynced = mcInformer.Informer().HasSynced
 
+	ctrl.nodeLister = nodeInformer.Lister()
+	ctrl.nodeListerSynced = nodeInformer.Informer().HasSynced
+
 	return ctrl
 }
 
@@ -109,7 +149,11 @@ func (ctrl *Controller) Run(workers int, stopCh <-chan struct{}) {
 	glog.Info("Starting MachineConfigController-RenderController")
 	defer glog.Info("Shutting down MachineConfigController-RenderController")
 
-	if !cache.WaitForCacheSync(stopCh, ctrl.mcpListerSynced, ctrl.mcListerSynced) {
+	cacheSyncs := []cache.InformerSynced{ctrl.mcpListerSynced, ctrl.mcListerSynced, ctrl.nodeListerSynced}
+	if ctrl.rmcbListerSynced != nil {
+		cacheSyncs = append(cacheSyncs, ctrl.rmcbListerSynced)
+	}
+	if !cache.WaitForCacheSync(stopCh, cacheSyncs...) {
 		return
 	}
 
@@ -371,6 +415,14 @@ func (ctrl *Controller) handleErr(err error, key interface{}) {
 
 // syncMachineConfigPool will sync the machineconfig pool with the given key.
 // This function is not meant to be invoked concurrently with the same key.
+//
+// Processing is driven by the render-phase state machine in state.go: the pool's current
+// RenderPhase is read off Status.Conditions, the handler registered for it is invoked, and
+// the phase it returns is persisted -- but only if the move is one the handler is allowed to
+// make; a handler error persists RenderPhaseFailed instead. A phase change is requeued immediately (fast path) so
+// the pool keeps advancing without waiting for the next informer resync; a Failed phase is
+// instead left to the queue's existing rate-limited retry (slow path), since handleErr
+// already backs off exponentially there.
 func (ctrl *Controller) syncMachineConfigPool(key string) error {
 	startTime := time.Now()
 	glog.V(4).Infof("Started syncing machineconfigpool %q (%v)", key, startTime)
@@ -400,87 +452,82 @@ func (ctrl *Controller) syncMachineConfigPool(key string) error {
 		return nil
 	}
 
-	selector, err := metav1.LabelSelectorAsSelector(pool.Spec.MachineConfigSelector)
-	if err != nil {
-		return err
-	}
-
-	mcs, err := ctrl.mcLister.List(selector)
-	if err != nil {
-		return err
-	}
-	if len(mcs) == 0 {
-		return fmt.Errorf("no MachineConfigs found matching selector %v", selector)
-	}
-
-	return ctrl.syncGeneratedMachineConfig(pool, mcs)
-}
-
-func (ctrl *Controller) syncGeneratedMachineConfig(pool *mcfgv1.MachineConfigPool, configs []*mcfgv1.MachineConfig) error {
-	if len(configs) == 0 {
-		return nil
-	}
-
-	generated, err := generateMachineConfig(pool, configs)
-	if err != nil {
-		return err
+	phase := getRenderPhase(pool)
+	handler, legalNext, ok := ctrl.stateFactory.HandlerFor(phase)
+	if !ok {
+		utilruntime.HandleError(fmt.Errorf("no render phase handler registered for %q on machineconfigpool %s, resetting to %s", phase, pool.Name, RenderPhasePending))
+		phase = RenderPhasePending
+		handler, legalNext, _ = ctrl.stateFactory.HandlerFor(phase)
 	}
 
-	source := []v1.ObjectReference{}
-	for _, cfg := range configs {
-		source = append(source, v1.ObjectReference{Kind: machineconfigKind.Kind, Name: cfg.GetName(), APIVersion: machineconfigKind.GroupVersion().String()})
+	next, handlerErr := handler(ctrl, pool)
+	if handlerErr != nil {
+		next = RenderPhaseFailed
 	}
 
-	_, err = ctrl.mcLister.Get(generated.Name)
-	if apierrors.IsNotFound(err) {
-		_, err = ctrl.client.MachineconfigurationV1().MachineConfigs().Create(generated)
-		glog.V(2).Infof("Generated machineconfig %s from %d configs: %s", generated.Name, len(source), source)
-	}
-	if err != nil {
-		return err
+	if !legalTransition(phase, next, legalNext) {
+		return fmt.Errorf("render phase handler for machineconfigpool %s requested illegal transition %s -> %s", pool.Name, phase, next)
 	}
 
-	if pool.Status.Configuration.Name == generated.Name {
-		_, _, err = resourceapply.ApplyMachineConfig(ctrl.client.MachineconfigurationV1(), generated)
-		return err
+	if next == RenderPhaseFailed {
+		ctrl.recordFailure(pool)
+	} else if phase == RenderPhaseFailed {
+		pool.Status.RenderAttempts = 0
 	}
 
-	pool.Status.Configuration.Name = generated.Name
-	pool.Status.Configuration.Source = source
-	_, err = ctrl.client.MachineconfigurationV1().MachineConfigPools().UpdateStatus(pool)
-	if err != nil {
-		return err
+	// UpdateStatus only persists pool.Status -- it silently drops any change a handler made to
+	// pool.Annotations (canary soak/pending tracking in strategy.go, the last-observed-configs
+	// digest in recordFailure). Those need a real Update to survive a restart or even the next
+	// sync, so issue one first whenever a handler actually touched the metadata.
+	if metadataChanged(machineconfigpool, pool) {
+		updated, err := ctrl.client.MachineconfigurationV1().MachineConfigPools().Update(pool)
+		if err != nil {
+			return err
+		}
+		pool.ObjectMeta = updated.ObjectMeta
+	}
+
+	// Compared against the pre-handler status, not the pre-setRenderPhase one: setRenderPhase
+	// itself is a no-op when the phase hasn't actually changed (see its own comment), so this
+	// only writes when the handler changed real Status fields or the phase genuinely moved.
+	// Without this check, the steady-state Rendered->Rendered transition would UpdateStatus
+	// every sync, which the MCP informer's updateMachineConfigPool would immediately
+	// re-enqueue -- a reconcile storm the content-hash dedup in chunk0-3 was meant to prevent.
+	originalStatus := machineconfigpool.Status.DeepCopy()
+	setRenderPhase(pool, next, fmt.Sprintf("machineconfigpool is in the %s phase", next))
+	if !reflect.DeepEqual(*originalStatus, pool.Status) {
+		if _, err := ctrl.client.MachineconfigurationV1().MachineConfigPools().UpdateStatus(pool); err != nil {
+			return err
+		}
 	}
 
-	gmcs, err := ctrl.mcLister.List(labels.Everything())
-	if err != nil {
-		return err
+	if handlerErr != nil {
+		return handlerErr
 	}
-	for _, gmc := range gmcs {
-		if gmc.Name == generated.Name {
-			continue
-		}
 
-		deleteOwnerRefPatch := fmt.Sprintf(`{"metadata":{"ownerReferences":[{"$patch":"delete","uid":"%s"}],"uid":"%s"}}`, pool.UID, gmc.UID)
-		_, err = ctrl.client.MachineconfigurationV1().MachineConfigs().Patch(gmc.Name, types.JSONPatchType, []byte(deleteOwnerRefPatch))
-		if err != nil {
-			if errors.IsNotFound(err) {
-				// If the machineconfig no longer exists, ignore it.
-				return nil
-			}
-			if errors.IsInvalid(err) {
-				// Invalid error will be returned in two cases: 1. the machineconfig
-				// has no owner reference, 2. the uid of the machineconfig doesn't
-				// match.
-				// In both cases, the error can be ignored.
-				return nil
-			}
+	if next != phase && next != RenderPhaseFailed {
+		ctrl.enqueueMachineConfigPool(pool)
+	} else if next == phase && phase == RenderPhaseRendering {
+		// The handler didn't advance, e.g. a Canary promotion deferred pending its soak --
+		// schedule a timed re-check for when the soak elapses instead of relying on the next
+		// incidental resync to notice.
+		if d := renderStrategyRequeueAfter(pool); d > 0 {
+			ctrl.queue.AddAfter(key, d)
 		}
 	}
 
 	return nil
 }
 
+// metadataChanged reports whether a phase handler changed anything in pool's ObjectMeta
+// relative to the copy originally read from the lister. UpdateStatus only persists
+// pool.Status, so this is how syncMachineConfigPool decides whether it also needs a plain
+// Update to keep annotation-tracked state (canary soak, last-observed-configs) from being
+// silently discarded.
+func metadataChanged(original, pool *mcfgv1.MachineConfigPool) bool {
+	return !reflect.DeepEqual(original.Annotations, pool.Annotations) || !reflect.DeepEqual(original.Labels, pool.Labels)
+}
+
 func generateMachineConfig(pool *mcfgv1.MachineConfigPool, configs []*mcfgv1.MachineConfig) (*mcfgv1.MachineConfig, error) {
 	merged := mcfgv1.MergeMachineConfigs(configs)
 	hashedName, err := getMachineConfigHashedName(pool, merged)
@@ -496,12 +543,22 @@ func generateMachineConfig(pool *mcfgv1.MachineConfigPool, configs []*mcfgv1.Mac
 	}
 	merged.Annotations[common.GeneratedByControllerVersionAnnotationKey] = version.Version.String()
 
+	contentHash, err := HashRenderedContent(merged)
+	if err != nil {
+		return nil, err
+	}
+	merged.Annotations[renderedContentHashAnnotationKey] = contentHash
+
 	return merged, nil
 }
 
 // RunBootstrap runs the render controller in bootstrap mode.
 // For each pool, it matches the machineconfigs based on label selector and
 // returns the generated machineconfigs and pool with CurrentMachineConfig status field set.
+// Status.Configuration is only set to the freshly generated config when the pool's
+// RenderStrategy is Immediate (or unset, which defaults to Immediate); Status.DesiredConfiguration
+// is always recorded so the normal controller can pick up and promote it later once the pool is
+// unpaused or its canary soak/approval is satisfied.
 func RunBootstrap(pools []*mcfgv1.MachineConfigPool, configs []*mcfgv1.MachineConfig) ([]*mcfgv1.MachineConfigPool, []*mcfgv1.MachineConfig, error) {
 	var (
 		opools   []*mcfgv1.MachineConfigPool
@@ -519,7 +576,10 @@ func RunBootstrap(pools []*mcfgv1.MachineConfigPool, configs []*mcfgv1.MachineCo
 			return nil, nil, err
 		}
 
-		pool.Status.Configuration.Name = generated.Name
+		pool.Status.DesiredConfiguration.Name = generated.Name
+		if pool.Spec.RenderStrategy == "" || pool.Spec.RenderStrategy == mcfgv1.RenderStrategyImmediate {
+			pool.Status.Configuration.Name = generated.Name
+		}
 		opools = append(opools, pool)
 		oconfigs = append(oconfigs, generated)
 	}
@@ -0,0 +1,385 @@
+package render
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/openshift/machine-config-operator/lib/resourceapply"
+	mcfgv1 "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// RenderPhase is a point in the MachineConfigPool render lifecycle, recorded on
+// Status.Conditions so operators and e2e tests have a stable, observable field instead of
+// having to infer progress from Status.Configuration alone.
+//
+// The usual path is (legalTransitions below lists every legal move):
+//
+//	Pending -> Selecting -> Rendering -> Superseded -> Rendered -> Rendering (new configs)
+//	              \            \                                        ^
+//	               \            ------------------------------> Failed -/ (via Selecting)
+//	                -----------------------------------------> Failed
+//
+// The queue worker looks up the current phase for a pool, invokes the handler registered
+// for it via the Factory, and only persists the phase the handler actually returned -- never
+// one it didn't request -- so a crash mid-handler always resumes in the last
+// successfully-recorded phase rather than skipping ahead.
+type RenderPhase string
+
+const (
+	// RenderPhasePending is the phase for a pool this controller has not looked at yet. It
+	// is also the zero value, so pools created before this state machine existed start here.
+	RenderPhasePending RenderPhase = "Pending"
+	// RenderPhaseSelecting means the controller is resolving the pool's MachineConfigSelector
+	// against the MachineConfig lister.
+	RenderPhaseSelecting RenderPhase = "Selecting"
+	// RenderPhaseRendering means a merged MachineConfig has been computed and is being
+	// created (or re-applied) against the API server.
+	RenderPhaseRendering RenderPhase = "Rendering"
+	// RenderPhaseSuperseded means a new MachineConfig has just been promoted onto
+	// Status.Configuration and the previously-owned MachineConfigs are being pruned. Keeping
+	// this as its own phase (rather than folding the pruning into Rendering) means a crash
+	// between promoting Status.Configuration.Name and pruning the old MCs is idempotently
+	// recoverable: the pool comes back up still in Superseded and just re-runs the prune.
+	RenderPhaseSuperseded RenderPhase = "Superseded"
+	// RenderPhaseRendered is the steady state: the generated MachineConfig named by
+	// Status.Configuration.Name exists in the API server and nothing owned by the pool is
+	// left to prune.
+	RenderPhaseRendered RenderPhase = "Rendered"
+	// RenderPhaseFailed means the last handler invocation returned an error. The pool is
+	// requeued on the queue's slow-backoff rate limiter until something changes; a later
+	// Selecting pass resumes normal processing.
+	RenderPhaseFailed RenderPhase = "Failed"
+)
+
+// renderPhaseConditionType is the MachineConfigPoolCondition.Type used to persist the
+// current RenderPhase on Status.Conditions.
+const renderPhaseConditionType mcfgv1.MachineConfigPoolConditionType = "RenderPhase"
+
+// lastObservedMachineConfigsAnnotationKey records a digest of the MachineConfig names last
+// observed for a pool, so a repeat failure against unchanged input can be told apart from a
+// failure triggered by newly-changed input.
+const lastObservedMachineConfigsAnnotationKey = "machineconfiguration.openshift.io/last-observed-configs"
+
+// legalTransitions enumerates, for each phase, the phases a handler registered for it is
+// allowed to request next. A handler returning anything else indicates a bug in the handler
+// and is rejected by syncMachineConfigPool rather than persisted.
+var legalTransitions = map[RenderPhase][]RenderPhase{
+	RenderPhasePending:    {RenderPhaseSelecting, RenderPhaseFailed},
+	RenderPhaseSelecting:  {RenderPhaseRendering, RenderPhaseFailed},
+	RenderPhaseRendering:  {RenderPhaseSuperseded, RenderPhaseRendered, RenderPhaseFailed},
+	RenderPhaseSuperseded: {RenderPhaseRendered, RenderPhaseFailed},
+	RenderPhaseRendered:   {RenderPhaseRendering, RenderPhaseRendered, RenderPhaseFailed},
+	RenderPhaseFailed:     {RenderPhaseSelecting, RenderPhaseFailed},
+}
+
+// phaseHandler runs the action for a single render phase and returns the phase the pool
+// should move to next. It must not persist pool itself -- syncMachineConfigPool persists the
+// returned phase (and any Status fields the handler set on pool) only when the requested
+// transition is legal; when the handler returns an error, the pool is persisted in
+// RenderPhaseFailed instead.
+type phaseHandler func(ctrl *Controller, pool *mcfgv1.MachineConfigPool) (RenderPhase, error)
+
+// Factory vends the phaseHandler registered for a given RenderPhase, along with the set of
+// phases that handler may legally request next.
+type Factory struct {
+	handlers map[RenderPhase]phaseHandler
+}
+
+// NewStateFactory returns a Factory wired up with the handler for every known RenderPhase.
+func NewStateFactory() *Factory {
+	return &Factory{
+		handlers: map[RenderPhase]phaseHandler{
+			RenderPhasePending:    handlePending,
+			RenderPhaseSelecting:  handleSelecting,
+			RenderPhaseRendering:  handleRendering,
+			RenderPhaseSuperseded: handleSuperseded,
+			RenderPhaseRendered:   handleRendered,
+			RenderPhaseFailed:     handleFailed,
+		},
+	}
+}
+
+// HandlerFor returns the handler registered for phase and the phases it may legally request
+// next. ok is false for an unrecognized phase, which the caller should treat as
+// RenderPhasePending.
+func (f *Factory) HandlerFor(phase RenderPhase) (handler phaseHandler, legalNext []RenderPhase, ok bool) {
+	handler, ok = f.handlers[phase]
+	return handler, legalTransitions[phase], ok
+}
+
+// legalTransition reports whether moving from `from` to `to` is either a no-op or one of the
+// phases `from`'s handler is registered to request.
+func legalTransition(from, to RenderPhase, legalNext []RenderPhase) bool {
+	if from == to {
+		return true
+	}
+	for _, p := range legalNext {
+		if p == to {
+			return true
+		}
+	}
+	return false
+}
+
+// getRenderPhase returns the RenderPhase currently recorded on pool, defaulting to
+// RenderPhasePending if none has been recorded yet.
+func getRenderPhase(pool *mcfgv1.MachineConfigPool) RenderPhase {
+	for _, c := range pool.Status.Conditions {
+		if c.Type == renderPhaseConditionType {
+			return RenderPhase(c.Reason)
+		}
+	}
+	return RenderPhasePending
+}
+
+// setRenderPhase records phase on pool.Status.Conditions, replacing any previously-recorded
+// RenderPhase condition. LastTransitionTime is only bumped when the Reason or Message
+// actually change: stamping it on every call -- even a Rendered -> Rendered no-op -- would
+// make syncMachineConfigPool's UpdateStatus think something changed every single sync,
+// turning the steady state into a perpetual status-write / requeue storm.
+func setRenderPhase(pool *mcfgv1.MachineConfigPool, phase RenderPhase, message string) {
+	for i, c := range pool.Status.Conditions {
+		if c.Type != renderPhaseConditionType {
+			continue
+		}
+		if c.Reason == string(phase) && c.Message == message {
+			return
+		}
+		pool.Status.Conditions[i].Status = v1.ConditionTrue
+		pool.Status.Conditions[i].Reason = string(phase)
+		pool.Status.Conditions[i].Message = message
+		pool.Status.Conditions[i].LastTransitionTime = metav1.Now()
+		return
+	}
+
+	pool.Status.Conditions = append(pool.Status.Conditions, mcfgv1.MachineConfigPoolCondition{
+		Type:               renderPhaseConditionType,
+		Status:             v1.ConditionTrue,
+		Reason:             string(phase),
+		Message:            message,
+		LastTransitionTime: metav1.Now(),
+	})
+}
+
+// handlePending moves a freshly-seen pool straight into Selecting; there is no action to
+// take in Pending itself.
+func handlePending(ctrl *Controller, pool *mcfgv1.MachineConfigPool) (RenderPhase, error) {
+	return RenderPhaseSelecting, nil
+}
+
+// handleSelecting resolves the pool's MachineConfigSelector. It exists as its own phase
+// (rather than being folded into Rendering) so a bad selector is caught before any
+// MachineConfig is generated. A selector error moves the pool to Failed like any other
+// handler error, and is retried on the same rate-limited backoff.
+func handleSelecting(ctrl *Controller, pool *mcfgv1.MachineConfigPool) (RenderPhase, error) {
+	if _, err := ctrl.selectMachineConfigs(pool); err != nil {
+		return RenderPhaseFailed, err
+	}
+	return RenderPhaseRendering, nil
+}
+
+// handleRendering computes the merged MachineConfig for the pool's currently-selected
+// configs, ensures it exists in the API server, and either re-applies it (if it is already
+// the promoted configuration) or, subject to the pool's RenderStrategy (see strategy.go),
+// promotes it. Invariant: Status.Configuration.Name is never set to a name that doesn't yet
+// exist in the API server.
+func handleRendering(ctrl *Controller, pool *mcfgv1.MachineConfigPool) (RenderPhase, error) {
+	mcs, err := ctrl.selectMachineConfigs(pool)
+	if err != nil {
+		return RenderPhaseFailed, err
+	}
+
+	generated, err := generateMachineConfig(pool, mcs)
+	if err != nil {
+		return RenderPhaseFailed, err
+	}
+	contentHash := generated.Annotations[renderedContentHashAnnotationKey]
+
+	if pool.Status.Configuration.Name != generated.Name && contentHash != "" && contentHash == pool.Status.Configuration.ContentHash {
+		// generated only got a new name because getMachineConfigHashedName mixes in pool
+		// identity and controller version -- the rendered content itself is unchanged.
+		// Skip creating a redundant MachineConfig and leave Status alone entirely, so
+		// nothing watching this pool gets a spurious requeue.
+		return RenderPhaseRendered, nil
+	}
+
+	source := []v1.ObjectReference{}
+	for _, cfg := range mcs {
+		source = append(source, v1.ObjectReference{Kind: machineconfigKind.Kind, Name: cfg.GetName(), APIVersion: machineconfigKind.GroupVersion().String()})
+	}
+
+	_, err = ctrl.mcLister.Get(generated.Name)
+	if apierrors.IsNotFound(err) {
+		if _, err := ctrl.client.MachineconfigurationV1().MachineConfigs().Create(generated); err != nil {
+			return RenderPhaseFailed, err
+		}
+		glog.V(2).Infof("Generated machineconfig %s from %d configs: %s", generated.Name, len(source), source)
+	} else if err != nil {
+		return RenderPhaseFailed, err
+	}
+
+	// Push the newly-generated config down to a per-node binding for every node in the
+	// pool, independent of whether RenderStrategy allows promoting it at the pool level --
+	// this is what lets a per-node canary track ahead of Status.Configuration.
+	if err := ctrl.syncNodeBindings(pool, generated.Name); err != nil {
+		return RenderPhaseFailed, err
+	}
+
+	pool.Status.DesiredConfiguration.Name = generated.Name
+	pool.Status.DesiredConfiguration.Source = source
+	pool.Status.DesiredConfiguration.ContentHash = contentHash
+
+	if pool.Status.Configuration.Name == generated.Name {
+		clearRenderStrategyCondition(pool)
+		if _, _, err := resourceapply.ApplyMachineConfig(ctrl.client.MachineconfigurationV1(), generated); err != nil {
+			return RenderPhaseFailed, err
+		}
+		return RenderPhaseRendered, nil
+	}
+
+	// generated.Name already exists in the API server at this point, so it's safe to promote
+	// -- but whether we actually do is gated by the pool's RenderStrategy.
+	promote, reason, message := ctrl.shouldPromote(pool, generated.Name)
+	if !promote {
+		setRenderStrategyCondition(pool, reason, message)
+		return RenderPhaseRendering, nil
+	}
+
+	delete(pool.Annotations, forceRenderAnnotationKey)
+	pool.Status.Configuration.Name = generated.Name
+	pool.Status.Configuration.Source = source
+	pool.Status.Configuration.ContentHash = contentHash
+	ctrl.pushRenderedConfig(pool.Name, generated, contentHash)
+	// The promotion itself is done, but pruning the MachineConfigs this pool used to own
+	// still has to happen in Superseded -- leave RenderPending recorded until that finishes,
+	// rather than clearing it here, so the condition actually reflects in-progress work.
+	setRenderStrategyCondition(pool, reasonRenderPending, fmt.Sprintf("promoting %s and pruning superseded machineconfigs", generated.Name))
+	return RenderPhaseSuperseded, nil
+}
+
+// handleSuperseded prunes the MachineConfigs this pool used to own but no longer does, now
+// that Status.Configuration.Name points at the newly-promoted config.
+func handleSuperseded(ctrl *Controller, pool *mcfgv1.MachineConfigPool) (RenderPhase, error) {
+	gmcs, err := ctrl.mcLister.List(labels.Everything())
+	if err != nil {
+		return RenderPhaseFailed, err
+	}
+	for _, gmc := range gmcs {
+		if gmc.Name == pool.Status.Configuration.Name {
+			continue
+		}
+
+		deleteOwnerRefPatch := fmt.Sprintf(`{"metadata":{"ownerReferences":[{"$patch":"delete","uid":"%s"}],"uid":"%s"}}`, pool.UID, gmc.UID)
+		_, err := ctrl.client.MachineconfigurationV1().MachineConfigs().Patch(gmc.Name, types.JSONPatchType, []byte(deleteOwnerRefPatch))
+		if err == nil || apierrors.IsNotFound(err) || apierrors.IsInvalid(err) {
+			// NotFound: the machineconfig is already gone.
+			// Invalid: either the machineconfig has no owner reference, or the uid of the
+			// machineconfig doesn't match ours. Both mean there's nothing left for us to prune.
+			continue
+		}
+		return RenderPhaseFailed, err
+	}
+	clearRenderStrategyCondition(pool)
+	return RenderPhaseRendered, nil
+}
+
+// handleRendered is the steady state. It re-resolves the selector so that a newly-added or
+// -removed MachineConfig is noticed and kicks the pool back into Rendering.
+//
+// The change check is keyed off the content hash, not generated.Name: the hashed name also
+// mixes in pool identity and the controller version (see getMachineConfigHashedName), so a
+// controller-version bump alone changes the name without changing the rendered payload. If
+// this compared names, that case would bounce straight back into Rendering, and
+// handleRendering's own content-hash-unchanged fast path returns RenderPhaseRendered without
+// ever updating Status.Configuration.Name -- an infinite Rendering<->Rendered loop.
+func handleRendered(ctrl *Controller, pool *mcfgv1.MachineConfigPool) (RenderPhase, error) {
+	mcs, err := ctrl.selectMachineConfigs(pool)
+	if err != nil {
+		return RenderPhaseFailed, err
+	}
+
+	generated, err := generateMachineConfig(pool, mcs)
+	if err != nil {
+		return RenderPhaseFailed, err
+	}
+
+	contentHash := generated.Annotations[renderedContentHashAnnotationKey]
+	if contentHash != "" && contentHash == pool.Status.Configuration.ContentHash {
+		return RenderPhaseRendered, nil
+	}
+	if generated.Name != pool.Status.Configuration.Name {
+		return RenderPhaseRendering, nil
+	}
+	return RenderPhaseRendered, nil
+}
+
+// handleFailed re-resolves the selector and, once it succeeds, hands the pool back to
+// Selecting to resume normal processing.
+func handleFailed(ctrl *Controller, pool *mcfgv1.MachineConfigPool) (RenderPhase, error) {
+	if _, err := ctrl.selectMachineConfigs(pool); err != nil {
+		return RenderPhaseFailed, err
+	}
+	return RenderPhaseSelecting, nil
+}
+
+// selectMachineConfigs resolves pool's MachineConfigSelector against the MachineConfig
+// lister. It is shared by every phase handler that needs the current config set, so they
+// all observe the same "no configs matched" error rather than each re-implementing it.
+func (ctrl *Controller) selectMachineConfigs(pool *mcfgv1.MachineConfigPool) ([]*mcfgv1.MachineConfig, error) {
+	selector, err := metav1.LabelSelectorAsSelector(pool.Spec.MachineConfigSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	mcs, err := ctrl.mcLister.List(selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(mcs) == 0 {
+		return nil, fmt.Errorf("no MachineConfigs found matching selector %v", selector)
+	}
+	return mcs, nil
+}
+
+// recordFailure updates pool's RenderAttempts to reflect a transition into RenderPhaseFailed.
+// RenderAttempts is only cleared when the MachineConfigs matched by the pool's selector have
+// changed since the last failure; otherwise it is incremented. This lets a caller distinguish
+// "still failing on the same input" (worth escalating) from "failing again on new input"
+// (worth a fresh set of retries).
+func (ctrl *Controller) recordFailure(pool *mcfgv1.MachineConfigPool) {
+	observed := ctrl.observedMachineConfigsDigest(pool)
+
+	if pool.Annotations == nil {
+		pool.Annotations = map[string]string{}
+	}
+	if last, seen := pool.Annotations[lastObservedMachineConfigsAnnotationKey]; !seen || last != observed {
+		pool.Status.RenderAttempts = 0
+	} else {
+		pool.Status.RenderAttempts++
+	}
+	pool.Annotations[lastObservedMachineConfigsAnnotationKey] = observed
+}
+
+// observedMachineConfigsDigest returns a stable digest of the names of the MachineConfigs
+// currently matched by pool's selector. Selector or lister errors collapse to the empty
+// digest, which is still good enough to detect a *subsequent* change in the matched set.
+func (ctrl *Controller) observedMachineConfigsDigest(pool *mcfgv1.MachineConfigPool) string {
+	mcs, err := ctrl.selectMachineConfigs(pool)
+	if err != nil {
+		return ""
+	}
+
+	names := make([]string, 0, len(mcs))
+	for _, mc := range mcs {
+		names = append(names, mc.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,141 @@
+package render
+
+import (
+	"testing"
+
+	mcfgv1 "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLegalTransition(t *testing.T) {
+	factory := NewStateFactory()
+
+	cases := []struct {
+		name  string
+		from  RenderPhase
+		to    RenderPhase
+		legal bool
+	}{
+		{"pending to selecting", RenderPhasePending, RenderPhaseSelecting, true},
+		{"pending to failed", RenderPhasePending, RenderPhaseFailed, true},
+		{"pending to rendering is illegal", RenderPhasePending, RenderPhaseRendering, false},
+		{"pending to rendered is illegal", RenderPhasePending, RenderPhaseRendered, false},
+		{"selecting to rendering", RenderPhaseSelecting, RenderPhaseRendering, true},
+		{"selecting to failed", RenderPhaseSelecting, RenderPhaseFailed, true},
+		{"selecting to superseded is illegal", RenderPhaseSelecting, RenderPhaseSuperseded, false},
+		{"rendering to superseded", RenderPhaseRendering, RenderPhaseSuperseded, true},
+		{"rendering to rendered", RenderPhaseRendering, RenderPhaseRendered, true},
+		{"rendering to failed", RenderPhaseRendering, RenderPhaseFailed, true},
+		{"rendering to selecting is illegal", RenderPhaseRendering, RenderPhaseSelecting, false},
+		{"rendering to pending is illegal", RenderPhaseRendering, RenderPhasePending, false},
+		{"superseded to rendered", RenderPhaseSuperseded, RenderPhaseRendered, true},
+		{"superseded to failed", RenderPhaseSuperseded, RenderPhaseFailed, true},
+		{"superseded to rendering is illegal", RenderPhaseSuperseded, RenderPhaseRendering, false},
+		{"rendered to rendering", RenderPhaseRendered, RenderPhaseRendering, true},
+		{"rendered to rendered", RenderPhaseRendered, RenderPhaseRendered, true},
+		{"rendered to failed", RenderPhaseRendered, RenderPhaseFailed, true},
+		{"rendered to superseded is illegal", RenderPhaseRendered, RenderPhaseSuperseded, false},
+		{"failed to selecting", RenderPhaseFailed, RenderPhaseSelecting, true},
+		{"failed to failed", RenderPhaseFailed, RenderPhaseFailed, true},
+		{"failed to rendered is illegal", RenderPhaseFailed, RenderPhaseRendered, false},
+		{"failed to rendering is illegal", RenderPhaseFailed, RenderPhaseRendering, false},
+		{"same phase is always legal even for an unregistered phase", RenderPhase("Bogus"), RenderPhase("Bogus"), true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, legalNext, _ := factory.HandlerFor(c.from)
+			if got := legalTransition(c.from, c.to, legalNext); got != c.legal {
+				t.Errorf("legalTransition(%s, %s) = %v, want %v", c.from, c.to, got, c.legal)
+			}
+		})
+	}
+}
+
+func TestHandlerForUnknownPhase(t *testing.T) {
+	factory := NewStateFactory()
+	if _, _, ok := factory.HandlerFor(RenderPhase("NotARealPhase")); ok {
+		t.Fatalf("expected HandlerFor to report ok=false for an unregistered phase")
+	}
+}
+
+func TestGetSetRenderPhase(t *testing.T) {
+	pool := &mcfgv1.MachineConfigPool{}
+
+	if phase := getRenderPhase(pool); phase != RenderPhasePending {
+		t.Fatalf("expected a pool with no RenderPhase condition to default to Pending, got %s", phase)
+	}
+
+	setRenderPhase(pool, RenderPhaseSelecting, "moving to selecting")
+	if phase := getRenderPhase(pool); phase != RenderPhaseSelecting {
+		t.Fatalf("expected Selecting after setRenderPhase, got %s", phase)
+	}
+
+	// A second call must replace the condition in place, not append a duplicate.
+	setRenderPhase(pool, RenderPhaseRendering, "moving to rendering")
+	var renderPhaseConds int
+	for _, c := range pool.Status.Conditions {
+		if c.Type == renderPhaseConditionType {
+			renderPhaseConds++
+		}
+	}
+	if renderPhaseConds != 1 {
+		t.Fatalf("expected exactly one RenderPhase condition after two calls to setRenderPhase, got %d", renderPhaseConds)
+	}
+	if phase := getRenderPhase(pool); phase != RenderPhaseRendering {
+		t.Fatalf("expected Rendering after second setRenderPhase, got %s", phase)
+	}
+}
+
+// invalidSelector fails metav1.LabelSelectorAsSelector before it ever reaches the
+// MachineConfig lister, so these tests can drive observedMachineConfigsDigest (and therefore
+// recordFailure) on a Controller with no lister wired up at all -- the digest just always
+// collapses to "", which is exactly the "selector or lister errors" case the function's own
+// doc comment already calls out as acceptable.
+var invalidSelector = &metav1.LabelSelector{
+	MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "k", Operator: "NotARealOperator"}},
+}
+
+// TestRecordFailureIsMonotonicAcrossASync exercises invariant (b) from the chunk0-1 request:
+// RenderAttempts only resets to 0 when the matched MachineConfigs have actually changed since
+// the last failure, not on every failing sync. It simulates a persisted resync by DeepCopy-ing
+// the pool between calls, the same way syncMachineConfigPool re-reads from the lister, so the
+// last-observed-configs annotation recordFailure relies on has to actually survive that round
+// trip for the counter to behave.
+func TestRecordFailureIsMonotonicAcrossASync(t *testing.T) {
+	ctrl := &Controller{}
+	pool := &mcfgv1.MachineConfigPool{}
+	pool.Spec.MachineConfigSelector = invalidSelector
+
+	ctrl.recordFailure(pool)
+	if pool.Status.RenderAttempts != 0 {
+		t.Fatalf("expected the first failure to leave RenderAttempts at 0, got %d", pool.Status.RenderAttempts)
+	}
+	firstObserved := pool.Annotations[lastObservedMachineConfigsAnnotationKey]
+
+	// Simulate the pool having been persisted and re-fetched for the next sync: a fresh
+	// DeepCopy carrying forward the annotation recordFailure just set.
+	pool = pool.DeepCopy()
+	if pool.Annotations[lastObservedMachineConfigsAnnotationKey] != firstObserved {
+		t.Fatalf("expected the observed-configs annotation to survive a DeepCopy")
+	}
+
+	ctrl.recordFailure(pool)
+	if pool.Status.RenderAttempts != 1 {
+		t.Fatalf("expected RenderAttempts to increment on a repeat failure against unchanged input, got %d", pool.Status.RenderAttempts)
+	}
+
+	pool = pool.DeepCopy()
+	ctrl.recordFailure(pool)
+	if pool.Status.RenderAttempts != 2 {
+		t.Fatalf("expected RenderAttempts to keep incrementing monotonically, got %d", pool.Status.RenderAttempts)
+	}
+
+	// Now simulate the matched MachineConfigs actually changing underneath a stale recorded
+	// digest: RenderAttempts must reset back to 0 rather than keep counting.
+	pool.Annotations[lastObservedMachineConfigsAnnotationKey] = "some-other-digest-from-before"
+	ctrl.recordFailure(pool)
+	if pool.Status.RenderAttempts != 0 {
+		t.Fatalf("expected RenderAttempts to reset to 0 once the observed digest changed, got %d", pool.Status.RenderAttempts)
+	}
+}
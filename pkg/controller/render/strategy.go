@@ -0,0 +1,199 @@
+package render
+
+import (
+	"fmt"
+	"time"
+
+	mcfgv1 "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// forceRenderAnnotationKey lets an operator manually unblock a Paused pool for exactly one
+// promotion: set it to the MC name named in the pool's RenderDeferred condition message. The
+// controller clears it again once that config is promoted, so it has to be re-applied for
+// the next one.
+const forceRenderAnnotationKey = "machineconfiguration.openshift.io/force-render"
+
+// canaryApprovedDataKey is the key the controller looks for in a pool's CanaryConfigMap. The
+// entry under this key approves the pending config for promotion when its value names it.
+const canaryApprovedDataKey = "approvedConfig"
+
+// canaryPendingAnnotationKey and canarySoakStartAnnotationKey track, per pool, which config a
+// canary soak is currently timing and when that soak began.
+const (
+	canaryPendingAnnotationKey   = "machineconfiguration.openshift.io/canary-pending-config"
+	canarySoakStartAnnotationKey = "machineconfiguration.openshift.io/canary-soak-start"
+)
+
+// renderStrategyConditionType is the MachineConfigPoolCondition.Type used to explain why a
+// DesiredConfiguration hasn't (yet) been promoted to Status.Configuration. Reasons are
+// modeled on cluster-api's topology-reconciled reasons, which follow the same
+// compute-then-gate-then-promote shape.
+const renderStrategyConditionType mcfgv1.MachineConfigPoolConditionType = "RenderProgressing"
+
+const (
+	// reasonRenderPending means DesiredConfiguration has just been promoted to Configuration
+	// and the MachineConfigs it superseded are still being pruned.
+	reasonRenderPending = "RenderPending"
+	// reasonRenderDeferred means promotion is withheld by the pool's RenderStrategy itself
+	// (Paused, or Canary still soaking/awaiting approval).
+	reasonRenderDeferred = "RenderDeferred"
+	// reasonRenderUpgradePending means promotion is blocked on something the operator needs
+	// to act on (a misconfigured strategy, an unreadable CanaryConfigMap).
+	reasonRenderUpgradePending = "RenderUpgradePending"
+)
+
+// shouldPromote decides whether desired -- the name of the freshly generated MachineConfig --
+// may be promoted to pool.Status.Configuration.Name given pool.Spec.RenderStrategy. It may
+// mutate pool's annotations (to track canary soak state) even when it returns false.
+func (ctrl *Controller) shouldPromote(pool *mcfgv1.MachineConfigPool, desired string) (promote bool, reason, message string) {
+	if pool.Annotations[forceRenderAnnotationKey] == desired {
+		return true, "", ""
+	}
+
+	strategy := pool.Spec.RenderStrategy
+	if strategy == "" {
+		// Immediate is the zero value so pools created before RenderStrategy existed keep
+		// their current behavior.
+		strategy = mcfgv1.RenderStrategyImmediate
+	}
+
+	switch strategy {
+	case mcfgv1.RenderStrategyImmediate:
+		return true, "", ""
+
+	case mcfgv1.RenderStrategyPaused:
+		return false, reasonRenderDeferred, fmt.Sprintf(
+			"render strategy is Paused; annotate the pool with %s=%s to promote %s", forceRenderAnnotationKey, desired, desired)
+
+	case mcfgv1.RenderStrategyCanary:
+		return ctrl.shouldPromoteCanary(pool, desired)
+
+	default:
+		return false, reasonRenderUpgradePending, fmt.Sprintf("unrecognized render strategy %q is blocking promotion of %s", strategy, desired)
+	}
+}
+
+// shouldPromoteCanary implements the Canary strategy: a promotion is withheld until the
+// pool's CanarySoakDuration has elapsed since desired was first seen pending, and until the
+// pool's CanaryConfigMap carries an explicit approval for it.
+func (ctrl *Controller) shouldPromoteCanary(pool *mcfgv1.MachineConfigPool, desired string) (bool, string, string) {
+	if pool.Annotations == nil {
+		pool.Annotations = map[string]string{}
+	}
+
+	if pool.Annotations[canaryPendingAnnotationKey] != desired {
+		pool.Annotations[canaryPendingAnnotationKey] = desired
+		pool.Annotations[canarySoakStartAnnotationKey] = time.Now().UTC().Format(time.RFC3339)
+		return false, reasonRenderDeferred, fmt.Sprintf("canary soak for %s has just started", desired)
+	}
+
+	soakStart, err := time.Parse(time.RFC3339, pool.Annotations[canarySoakStartAnnotationKey])
+	if err != nil {
+		soakStart = time.Now()
+		pool.Annotations[canarySoakStartAnnotationKey] = soakStart.UTC().Format(time.RFC3339)
+	}
+
+	if soak := pool.Spec.CanarySoakDuration; soak != nil {
+		if remaining := soak.Duration - time.Since(soakStart); remaining > 0 {
+			return false, reasonRenderDeferred, fmt.Sprintf("canary soak for %s has %s remaining", desired, remaining.Round(time.Second))
+		}
+	}
+
+	approved, err := ctrl.canaryApproved(pool, desired)
+	if err != nil {
+		return false, reasonRenderUpgradePending, fmt.Sprintf("could not read CanaryConfigMap for %s: %v", desired, err)
+	}
+	if !approved {
+		return false, reasonRenderDeferred, fmt.Sprintf("canary soak elapsed for %s but it has not been approved in the CanaryConfigMap yet", desired)
+	}
+	return true, "", ""
+}
+
+// canaryApprovalPollInterval bounds how long a Canary pool whose soak has already elapsed can
+// go without re-checking its CanaryConfigMap for approval. There is no informer watching that
+// ConfigMap, so without this an operator's approval would only be noticed on whatever
+// incidental resync happens to come along next -- unbounded in the worst case.
+const canaryApprovalPollInterval = 30 * time.Second
+
+// renderStrategyRequeueAfter returns how long syncMachineConfigPool should wait before
+// re-evaluating a pool parked in Rendering by a Canary strategy, so a promotion doesn't have
+// to wait on an incidental resync. It returns 0 when there's no known future time worth waking
+// up for: any strategy other than Canary, or a Canary with no CanarySoakDuration configured.
+func renderStrategyRequeueAfter(pool *mcfgv1.MachineConfigPool) time.Duration {
+	if pool.Spec.RenderStrategy != mcfgv1.RenderStrategyCanary {
+		return 0
+	}
+	if pool.Spec.CanarySoakDuration == nil {
+		return 0
+	}
+
+	soakStart, err := time.Parse(time.RFC3339, pool.Annotations[canarySoakStartAnnotationKey])
+	if err != nil {
+		return 0
+	}
+
+	if remaining := pool.Spec.CanarySoakDuration.Duration - time.Since(soakStart); remaining > 0 {
+		return remaining
+	}
+
+	// The soak has elapsed, so promotion is now only waiting on a human to update the
+	// CanaryConfigMap. Poll for that at a bounded interval instead of returning 0, which would
+	// leave the approval unnoticed until some other event happens to resync the pool.
+	return canaryApprovalPollInterval
+}
+
+// canaryApproved reports whether the pool's CanaryConfigMap explicitly approves desired.
+func (ctrl *Controller) canaryApproved(pool *mcfgv1.MachineConfigPool, desired string) (bool, error) {
+	ref := pool.Spec.CanaryConfigMap
+	if ref == nil {
+		return false, fmt.Errorf("render strategy is Canary but the pool has no CanaryConfigMap configured")
+	}
+
+	cm, err := ctrl.kubeClient.CoreV1().ConfigMaps(ref.Namespace).Get(ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	return cm.Data[canaryApprovedDataKey] == desired, nil
+}
+
+// setRenderStrategyCondition records why promotion is currently blocked, replacing any
+// previously-recorded RenderProgressing condition. Like setRenderPhase, it only bumps
+// LastTransitionTime when the Reason or Message actually change, so a Canary pool parked
+// waiting on approval -- where shouldPromoteCanary reports the same reason/message every
+// single sync -- doesn't turn into a status-write storm of its own.
+func setRenderStrategyCondition(pool *mcfgv1.MachineConfigPool, reason, message string) {
+	for i, c := range pool.Status.Conditions {
+		if c.Type != renderStrategyConditionType {
+			continue
+		}
+		if c.Reason == reason && c.Message == message {
+			return
+		}
+		pool.Status.Conditions[i].Status = v1.ConditionTrue
+		pool.Status.Conditions[i].Reason = reason
+		pool.Status.Conditions[i].Message = message
+		pool.Status.Conditions[i].LastTransitionTime = metav1.Now()
+		return
+	}
+
+	pool.Status.Conditions = append(pool.Status.Conditions, mcfgv1.MachineConfigPoolCondition{
+		Type:               renderStrategyConditionType,
+		Status:             v1.ConditionTrue,
+		Reason:             reason,
+		Message:            message,
+		LastTransitionTime: metav1.Now(),
+	})
+}
+
+// clearRenderStrategyCondition removes the RenderProgressing condition once a pool's
+// DesiredConfiguration has been promoted and nothing is left blocking it.
+func clearRenderStrategyCondition(pool *mcfgv1.MachineConfigPool) {
+	for i, c := range pool.Status.Conditions {
+		if c.Type == renderStrategyConditionType {
+			pool.Status.Conditions = append(pool.Status.Conditions[:i], pool.Status.Conditions[i+1:]...)
+			return
+		}
+	}
+}
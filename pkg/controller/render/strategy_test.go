@@ -0,0 +1,97 @@
+package render
+
+import (
+	"testing"
+	"time"
+
+	mcfgv1 "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestShouldPromoteCanarySoakSurvivesAResync proves the canary soak timer doesn't reset every
+// sync: once a soak has started, calling shouldPromoteCanary again against the same
+// (DeepCopy-simulated-persisted) annotations must see the soak as already in progress rather
+// than restarting it from time.Now(). This is the behavior that depended on
+// syncMachineConfigPool actually persisting pool.Annotations (see the chunk0-1 fix).
+func TestShouldPromoteCanarySoakSurvivesAResync(t *testing.T) {
+	ctrl := &Controller{}
+	pool := &mcfgv1.MachineConfigPool{}
+	pool.Spec.RenderStrategy = mcfgv1.RenderStrategyCanary
+	pool.Spec.CanarySoakDuration = &metav1.Duration{Duration: time.Hour}
+
+	promote, reason, _ := ctrl.shouldPromoteCanary(pool, "rendered-worker-aaa")
+	if promote || reason != reasonRenderDeferred {
+		t.Fatalf("expected the first call to defer with reason %s, got promote=%v reason=%s", reasonRenderDeferred, promote, reason)
+	}
+	soakStart := pool.Annotations[canarySoakStartAnnotationKey]
+	if soakStart == "" {
+		t.Fatalf("expected shouldPromoteCanary to record a soak start timestamp")
+	}
+
+	// Simulate the pool having been persisted and re-fetched for the next sync.
+	pool = pool.DeepCopy()
+
+	promote, reason, _ = ctrl.shouldPromoteCanary(pool, "rendered-worker-aaa")
+	if promote || reason != reasonRenderDeferred {
+		t.Fatalf("expected the soak to still be in progress after a resync, got promote=%v reason=%s", promote, reason)
+	}
+	if pool.Annotations[canarySoakStartAnnotationKey] != soakStart {
+		t.Fatalf("expected the soak start timestamp to survive a resync unchanged, got %s, want %s",
+			pool.Annotations[canarySoakStartAnnotationKey], soakStart)
+	}
+}
+
+// TestShouldPromoteCanaryBlocksWithoutCanaryConfigMap proves an elapsed soak alone does not
+// promote: without a CanaryConfigMap to approve the pending config, promotion stays blocked.
+func TestShouldPromoteCanaryBlocksWithoutCanaryConfigMap(t *testing.T) {
+	pool := &mcfgv1.MachineConfigPool{}
+	pool.Spec.RenderStrategy = mcfgv1.RenderStrategyCanary
+	pool.Spec.CanarySoakDuration = &metav1.Duration{Duration: time.Hour}
+	pool.Annotations = map[string]string{
+		canaryPendingAnnotationKey:   "rendered-worker-aaa",
+		canarySoakStartAnnotationKey: time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339),
+	}
+	// No CanaryConfigMap configured: canaryApproved will error, which must block promotion
+	// with RenderUpgradePending rather than panicking or silently promoting.
+	ctrl := &Controller{}
+
+	promote, reason, _ := ctrl.shouldPromoteCanary(pool, "rendered-worker-aaa")
+	if promote || reason != reasonRenderUpgradePending {
+		t.Fatalf("expected an elapsed soak with no CanaryConfigMap to block with %s, got promote=%v reason=%s",
+			reasonRenderUpgradePending, promote, reason)
+	}
+}
+
+func TestRenderStrategyRequeueAfter(t *testing.T) {
+	immediate := &mcfgv1.MachineConfigPool{}
+	if d := renderStrategyRequeueAfter(immediate); d != 0 {
+		t.Errorf("expected no requeue for a non-Canary pool, got %s", d)
+	}
+
+	noSoak := &mcfgv1.MachineConfigPool{}
+	noSoak.Spec.RenderStrategy = mcfgv1.RenderStrategyCanary
+	if d := renderStrategyRequeueAfter(noSoak); d != 0 {
+		t.Errorf("expected no requeue for a Canary pool with no CanarySoakDuration, got %s", d)
+	}
+
+	midSoak := &mcfgv1.MachineConfigPool{}
+	midSoak.Spec.RenderStrategy = mcfgv1.RenderStrategyCanary
+	midSoak.Spec.CanarySoakDuration = &metav1.Duration{Duration: time.Hour}
+	midSoak.Annotations = map[string]string{
+		canarySoakStartAnnotationKey: time.Now().Add(-10 * time.Minute).UTC().Format(time.RFC3339),
+	}
+	d := renderStrategyRequeueAfter(midSoak)
+	if d <= 0 || d > time.Hour {
+		t.Errorf("expected a requeue somewhere in (0, 1h] for a soak 10m into a 1h window, got %s", d)
+	}
+
+	elapsedSoak := &mcfgv1.MachineConfigPool{}
+	elapsedSoak.Spec.RenderStrategy = mcfgv1.RenderStrategyCanary
+	elapsedSoak.Spec.CanarySoakDuration = &metav1.Duration{Duration: time.Hour}
+	elapsedSoak.Annotations = map[string]string{
+		canarySoakStartAnnotationKey: time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339),
+	}
+	if d := renderStrategyRequeueAfter(elapsedSoak); d != canaryApprovalPollInterval {
+		t.Errorf("expected an approval poll every %s once the soak has already elapsed (only approval is pending), got %s", canaryApprovalPollInterval, d)
+	}
+}